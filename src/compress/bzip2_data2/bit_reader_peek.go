@@ -0,0 +1,26 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bzip2
+
+// peekBits returns the next bits bits of the stream without consuming them,
+// pulling bytes from the underlying reader into br.n as needed but leaving
+// br.bits reduced only by a later, explicit consume (the caller does that by
+// subtracting from br.bits itself, the same way ReadBits64 does).
+//
+// It reports ok=false, without touching br.err, if the underlying reader
+// runs dry before bits bits are available. That happens near the end of
+// the input: the caller falls back to reading bit-by-bit, which may still
+// succeed using fewer bits than peekBits was asked for.
+func (br *bitReader) peekBits(bits uint) (n uint16, ok bool) {
+	for br.bits < bits {
+		b, err := br.r.ReadByte()
+		if err != nil {
+			return 0, false
+		}
+		br.n = br.n<<8 | uint64(b)
+		br.bits += 8
+	}
+	return uint16(br.n>>(br.bits-bits)) & (1<<bits - 1), true
+}
@@ -0,0 +1,80 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bzip2
+
+import (
+	"bufio"
+	"io"
+)
+
+// bitWriter is the mirror image of bitReader: it accumulates bits,
+// most-significant bit first, and writes whole bytes to the underlying
+// io.Writer as they fill up. Like bitReader, its Write* methods don't
+// return the usual error; call Err afterwards to check for one.
+type bitWriter struct {
+	w    *bufio.Writer
+	n    uint64
+	bits uint
+	err  error
+}
+
+// newBitWriter returns a new bitWriter that writes to w, buffering output
+// through a bufio.Writer so that individual bit writes don't each cause a
+// separate call into w.
+func newBitWriter(w io.Writer) bitWriter {
+	return bitWriter{w: bufio.NewWriter(w)}
+}
+
+// WriteBits writes the low bits bits of v, most-significant bit first.
+func (bw *bitWriter) WriteBits(v uint32, bits uint) {
+	if bw.err != nil {
+		return
+	}
+	bw.n = bw.n<<bits | uint64(v)&(1<<bits-1)
+	bw.bits += bits
+
+	for bw.bits >= 8 {
+		bw.bits -= 8
+		if err := bw.w.WriteByte(byte(bw.n >> bw.bits)); err != nil {
+			bw.err = err
+			return
+		}
+	}
+}
+
+// WriteBits64 is like WriteBits but accepts values up to 64 bits wide, for
+// the block and end-of-stream magic numbers.
+func (bw *bitWriter) WriteBits64(v uint64, bits uint) {
+	if bits > 32 {
+		bw.WriteBits(uint32(v>>32), bits-32)
+		bits = 32
+	}
+	bw.WriteBits(uint32(v), bits)
+}
+
+// WriteBit writes a single bit.
+func (bw *bitWriter) WriteBit(bit bool) {
+	if bit {
+		bw.WriteBits(1, 1)
+	} else {
+		bw.WriteBits(0, 1)
+	}
+}
+
+// Flush pads any partial byte with zero bits, writes it out and flushes the
+// underlying bufio.Writer.
+func (bw *bitWriter) Flush() error {
+	if bw.err == nil && bw.bits > 0 {
+		bw.WriteBits(0, 8-bw.bits)
+	}
+	if bw.err == nil {
+		bw.err = bw.w.Flush()
+	}
+	return bw.err
+}
+
+func (bw *bitWriter) Err() error {
+	return bw.err
+}
@@ -0,0 +1,194 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bzip2
+
+// groupSize is the number of MTF/RLE2 symbols covered by a single Huffman
+// table selector, as fixed by the bzip2 format.
+const groupSize = 50
+
+// symbolsPresent returns the distinct byte values used in data, in
+// ascending order. This both drives the two-level 16x16 "used bitmap"
+// written into the block header and seeds the initial move-to-front list,
+// exactly as the decoder reconstructs it from that same bitmap.
+func symbolsPresent(data []byte) []byte {
+	var present [256]bool
+	for _, b := range data {
+		present[b] = true
+	}
+	used := make([]byte, 0, 256)
+	for i := 0; i < 256; i++ {
+		if present[i] {
+			used = append(used, byte(i))
+		}
+	}
+	return used
+}
+
+// mtfRLE2Encode applies the move-to-front transform to the BWT output and
+// run-length encodes the resulting zeros with the RUNA/RUNB metasymbols,
+// producing the alphabet that the block's Huffman tables are built over:
+// 0 and 1 are RUNA and RUNB, 2..len(used) are MTF indexes 1..len(used)-1
+// shifted up by one (index 0 is never emitted directly; it is always
+// absorbed into a run), and len(used)+1 is the end-of-block symbol.
+func mtfRLE2Encode(data []byte, used []byte) []uint16 {
+	mtf := newMTFDecoder(append([]byte(nil), used...))
+
+	var symbols []uint16
+	run := 0
+	for _, b := range data {
+		idx := mtf.Encode(b)
+		if idx == 0 {
+			run++
+			continue
+		}
+		symbols = appendRunLength(symbols, run)
+		run = 0
+		symbols = append(symbols, uint16(idx+1))
+	}
+	symbols = appendRunLength(symbols, run)
+	symbols = append(symbols, uint16(len(used)+1))
+	return symbols
+}
+
+// appendRunLength appends the RUNA/RUNB digits that decode a run of n
+// consecutive move-to-front index zeros. The decoder reconstructs n from a
+// digit sequence v_0..v_k-1 (RUNA=0, RUNB=1) as sum(2**(i+v_i)); that is a
+// bijective base-2 representation of n using digits {1, 2} (RUNA standing
+// for digit 1, RUNB for digit 2), which is what the loop below produces,
+// least-significant digit first.
+func appendRunLength(symbols []uint16, n int) []uint16 {
+	for n > 0 {
+		d := (n-1)%2 + 1
+		if d == 1 {
+			symbols = append(symbols, 0) // RUNA
+		} else {
+			symbols = append(symbols, 1) // RUNB
+		}
+		n = (n - d) / 2
+	}
+	return symbols
+}
+
+// splitGroups partitions symbols into consecutive chunks of groupSize,
+// matching the points at which the block decoder switches Huffman tables.
+func splitGroups(symbols []uint16) [][]uint16 {
+	var groups [][]uint16
+	for i := 0; i < len(symbols); i += groupSize {
+		end := i + groupSize
+		if end > len(symbols) {
+			end = len(symbols)
+		}
+		groups = append(groups, symbols[i:end])
+	}
+	return groups
+}
+
+// numHuffmanTables picks how many Huffman tables to use for a block holding
+// nSymbols MTF/RLE2 symbols, following the same thresholds as the reference
+// bzip2 encoder: small blocks don't carry enough symbols to amortize the
+// cost of extra tables and their selectors.
+func numHuffmanTables(nSymbols int) int {
+	switch {
+	case nSymbols < 200:
+		return 2
+	case nSymbols < 600:
+		return 3
+	case nSymbols < 1200:
+		return 4
+	case nSymbols < 2400:
+		return 5
+	default:
+		return 6
+	}
+}
+
+// buildTables chooses a selector (Huffman table index) for every group and
+// the code lengths for every table, alternating between the two: groups are
+// first spread evenly across the tables, then a few rounds of reassigning
+// each group to whichever table currently encodes it most cheaply and
+// rebuilding the tables from the resulting frequencies converge on a good
+// joint assignment. This mirrors sendMTFValues in the reference encoder.
+func buildTables(groups [][]uint16, alphaSize int) (tables [][]uint8, selectors []uint8) {
+	nSymbols := 0
+	for _, g := range groups {
+		nSymbols += len(g)
+	}
+	numTables := numHuffmanTables(nSymbols)
+	if numTables > len(groups) {
+		// Having more tables than groups to select from just wastes
+		// header bytes; nothing requires it, so keep it bounded but
+		// still within the format's [2,6] range.
+		numTables = len(groups)
+		if numTables < 2 {
+			numTables = 2
+		}
+	}
+
+	selectors = make([]uint8, len(groups))
+	for i := range selectors {
+		selectors[i] = uint8((i * numTables) / len(groups))
+	}
+
+	tables = make([][]uint8, numTables)
+	const passes = 4
+	for pass := 0; pass < passes; pass++ {
+		freqs := make([][]uint32, numTables)
+		for t := range freqs {
+			freqs[t] = make([]uint32, alphaSize)
+		}
+		for gi, g := range groups {
+			f := freqs[selectors[gi]]
+			for _, s := range g {
+				f[s]++
+			}
+		}
+
+		for t := range tables {
+			if !anyFreq(freqs[t]) {
+				// An unused table still needs a valid code: seed
+				// it with the two metasymbols so it decodes (even
+				// though nothing will reference it).
+				freqs[t][0] = 1
+				freqs[t][1] = 1
+			}
+			tables[t] = buildCodeLengths(freqs[t], 20)
+		}
+
+		if pass == passes-1 {
+			break
+		}
+
+		for gi, g := range groups {
+			best, bestCost := 0, groupCost(g, tables[0])
+			for t := 1; t < numTables; t++ {
+				if cost := groupCost(g, tables[t]); cost < bestCost {
+					best, bestCost = t, cost
+				}
+			}
+			selectors[gi] = uint8(best)
+		}
+	}
+
+	return tables, selectors
+}
+
+func anyFreq(freq []uint32) bool {
+	for _, f := range freq {
+		if f > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// groupCost estimates the number of bits needed to encode syms with the
+// Huffman table described by lengths.
+func groupCost(syms []uint16, lengths []uint8) int {
+	cost := 0
+	for _, s := range syms {
+		cost += int(lengths[s])
+	}
+	return cost
+}
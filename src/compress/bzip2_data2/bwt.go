@@ -0,0 +1,58 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bzip2
+
+import "sort"
+
+// forwardBWT computes the Burrows-Wheeler transform of block: the bytes
+// that precede each of the block's rotations once those rotations are
+// sorted. It returns the transformed bytes together with origPtr, the
+// index of the unrotated block within the sorted order, which is exactly
+// what inverseBWT expects as its origPtr argument.
+//
+// This builds the sorted rotation order with a comparison sort rather than
+// a linear-time suffix-array construction, which keeps the encoder's size
+// and complexity proportionate to the rest of this package. The trade-off
+// is real: two rotations can only be told apart by how far their bytes
+// happen to match, so highly repetitive input — exactly what bzip2 is
+// usually asked to compress — pushes comparisons towards O(n) each and the
+// sort towards O(n^2 log n) overall, rather than the near-linear time a
+// suffix array gives.
+func forwardBWT(block []byte) (transformed []byte, origPtr uint32) {
+	n := len(block)
+
+	// doubled lets the comparator read n bytes starting at any rotation
+	// offset without wrapping the index arithmetic.
+	doubled := make([]byte, 2*n)
+	copy(doubled, block)
+	copy(doubled[n:], block)
+
+	rotations := make([]int, n)
+	for i := range rotations {
+		rotations[i] = i
+	}
+
+	sort.Slice(rotations, func(a, b int) bool {
+		i, j := rotations[a], rotations[b]
+		// Rotations only compare equal here if block is periodic; in
+		// that case the tie is broken by the starting offset, which
+		// keeps the sort (and thus the transform) well defined.
+		for k := 0; k < n; k++ {
+			if doubled[i+k] != doubled[j+k] {
+				return doubled[i+k] < doubled[j+k]
+			}
+		}
+		return i < j
+	})
+
+	transformed = make([]byte, n)
+	for i, r := range rotations {
+		transformed[i] = doubled[r+n-1]
+		if r == 0 {
+			origPtr = uint32(i)
+		}
+	}
+	return transformed, origPtr
+}
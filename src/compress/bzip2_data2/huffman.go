@@ -14,6 +14,13 @@ type huffmanTree struct {
 	// of nodes to use when the tree is being constructed.
 	nodes    []huffmanNode
 	nextNode int
+
+	// fastBits and fastTable are an alternative decoding representation
+	// built alongside nodes: fastTable is indexed by the next fastBits
+	// bits of the stream and, for any code no longer than that, gives the
+	// symbol directly. See huffman_fast.go.
+	fastBits  uint8
+	fastTable []fastDecodeEntry
 }
 
 // A huffmanNode is a node in the tree. left and right contain indexes into the
@@ -33,9 +40,31 @@ const invalidNodeValue = 0xffff
 
 // Decode reads bits from the given bitReader and navigates the tree until a
 // symbol is found.
+//
+// It first tries t.fastTable, which covers every code up to t.fastBits bits
+// in one lookup of the next t.fastBits bits peeked (not yet consumed) from
+// br; a hit there resolves the symbol (or, for a code longer than
+// t.fastBits, the node to resume from) without the bit-by-bit walk that
+// decodeFrom otherwise does. Falling short of t.fastBits bits, e.g. near
+// the end of the input, just falls back to decodeFrom from the root.
 func (t *huffmanTree) Decode(br *bitReader) (v uint16) {
-	nodeIndex := uint16(0) // node 0 is the root of the tree.
+	if t.fastBits > 0 {
+		if prefix, ok := br.peekBits(uint(t.fastBits)); ok {
+			e := t.fastTable[prefix]
+			br.bits -= uint(e.bits)
+			if e.leaf {
+				return e.sym
+			}
+			return t.decodeFrom(br, e.node)
+		}
+	}
+	return t.decodeFrom(br, 0)
+}
 
+// decodeFrom is Decode's bit-by-bit tree walk, starting from nodeIndex
+// rather than always the root so that Decode's fast-table path can resume
+// it partway down the tree.
+func (t *huffmanTree) decodeFrom(br *bitReader, nodeIndex uint16) (v uint16) {
 	for {
 		node := &t.nodes[nodeIndex]
 
@@ -91,7 +120,30 @@ func newHuffmanTree(lengths []uint8) (huffmanTree, error) {
 	}
 
 	var t huffmanTree
+	codes := canonicalHuffmanCodes(lengths)
 
+	t.nodes = make([]huffmanNode, len(codes.code))
+	_, err := buildHuffmanNode(&t, codes, 0, 0, len(codes.code))
+	if err != nil {
+		return t, err
+	}
+
+	t.fastBits = fastTableBits(&t)
+	t.fastTable = newFastTable(&t, t.fastBits)
+	return t, nil
+}
+
+// canonicalHuffmanCodes assigns a canonical Huffman code to each symbol
+// given its code length, using the construction described above: symbols
+// are ordered by (length, value), the longest codes are assigned first
+// starting from an all-zero code packed at the most-significant end of a
+// uint32, and the result is finally sorted by code so that it is ready to
+// be consumed by buildHuffmanNode.
+//
+// newHuffmanTree uses this to build a decode tree; the bzip2 Writer uses it
+// directly to obtain the code/length pairs it needs to emit bits for a
+// symbol, so the two share exactly one notion of what "canonical" means.
+func canonicalHuffmanCodes(lengths []uint8) huffmanCodes {
 	// First we sort the code length assignments by ascending code length,
 	// using the symbol value to break ties.
 	pairs := make([]huffmanSymbolLengthPair, len(lengths))
@@ -140,10 +192,7 @@ func newHuffmanTree(lengths []uint8) (huffmanTree, error) {
 	// Now we can sort by the code so that the left half of each branch are
 	// grouped together, recursively.
 	sort.Sort(&codes)
-
-	t.nodes = make([]huffmanNode, len(codes.code))
-	_, err := buildHuffmanNode(&t, codes, 0, 0, len(codes.code))
-	return t, err
+	return codes
 }
 
 // huffmanSymbolLengthPair contains a symbol and its code length.
@@ -0,0 +1,121 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bzip2
+
+import "sort"
+
+// buildCodeLengths returns a set of Huffman code lengths for the given
+// symbol frequencies, none of which exceeds maxLength. freq is modified in
+// place.
+//
+// It builds an ordinary Huffman tree and, if that tree turns out deeper
+// than maxLength allows, flattens the frequency distribution and tries
+// again. This is the same rescaling trick the reference bzip2 encoder uses
+// in hbMakeCodeLengths: it converges quickly because each rescale roughly
+// halves the ratio between the largest and smallest frequency, which is
+// what drives the tree's depth.
+func buildCodeLengths(freq []uint32, maxLength int) []uint8 {
+	lengths := make([]uint8, len(freq))
+	for {
+		depth := huffmanDepths(freq)
+
+		max := 0
+		for _, d := range depth {
+			if d > max {
+				max = d
+			}
+		}
+		if max <= maxLength {
+			for i, d := range depth {
+				lengths[i] = uint8(d)
+			}
+			return lengths
+		}
+
+		for i, f := range freq {
+			freq[i] = 1 + f/2
+		}
+	}
+}
+
+// huffmanDepths computes the depth of each symbol's leaf in an ordinary
+// (not length-limited) Huffman tree built from weight, using the standard
+// greedy merge of the two lightest nodes. Symbols with zero weight are
+// treated as if they had weight one, since every symbol in a bzip2 alphabet
+// must still receive a code.
+func huffmanDepths(weight []uint32) []int {
+	n := len(weight)
+	depth := make([]int, n)
+	if n < 2 {
+		return depth
+	}
+
+	type node struct {
+		w           uint64
+		left, right int // index into nodes; -1 for a leaf
+		symbol      int
+	}
+	nodes := make([]node, n, 2*n-1)
+	for i, w := range weight {
+		if w == 0 {
+			w = 1
+		}
+		nodes[i] = node{w: uint64(w), left: -1, right: -1, symbol: i}
+	}
+
+	// active holds the indexes of nodes not yet merged. bzip2 alphabets
+	// are at most 258 symbols, so resorting it on every merge is cheap
+	// next to the entropy coding it feeds.
+	active := make([]int, n)
+	for i := range active {
+		active[i] = i
+	}
+
+	for len(active) > 1 {
+		sort.Slice(active, func(i, j int) bool {
+			return nodes[active[i]].w < nodes[active[j]].w
+		})
+		a, b := active[0], active[1]
+		nodes = append(nodes, node{w: nodes[a].w + nodes[b].w, left: a, right: b, symbol: -1})
+		active = append(active[2:], len(nodes)-1)
+	}
+
+	var walk func(idx, d int)
+	walk = func(idx, d int) {
+		nd := &nodes[idx]
+		if nd.left == -1 {
+			depth[nd.symbol] = d
+			return
+		}
+		walk(nd.left, d+1)
+		walk(nd.right, d+1)
+	}
+	walk(active[0], 0)
+	return depth
+}
+
+// canonicalHuffmanCodeTable returns, for each symbol, the right-aligned bit
+// pattern and length that the Writer must emit so that huffmanTree.Decode,
+// fed those bits in order, reports that symbol.
+//
+// buildHuffmanNode groups codes whose bit is 0 at a given level under
+// node.left and codes whose bit is 1 under node.right, but Decode steps
+// into node.left on a read bit of 1 and node.right on a read bit of 0: the
+// transmitted bit at each level is the complement of the corresponding bit
+// of the canonical code used to build the tree. canonicalHuffmanCodeTable
+// applies that same complement so its output can be written directly.
+func canonicalHuffmanCodeTable(lengths []uint8) (code []uint32, length []uint8) {
+	codes := canonicalHuffmanCodes(lengths)
+
+	code = make([]uint32, len(lengths))
+	length = make([]uint8, len(lengths))
+	for i, sym := range codes.value {
+		l := codes.codeLen[i]
+		bits := codes.code[i] >> (32 - l)
+		code[sym] = bits ^ (1<<l - 1)
+		length[sym] = l
+	}
+	return code, length
+}
@@ -0,0 +1,93 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bzip2
+
+// maxFastBits bounds the width of the table built by newFastTable. Wider
+// tables decode more codes in one lookup but cost 2^bits entries to build
+// and hold, so this is a ceiling rather than a target: fastTableBits still
+// shrinks it to the tree's actual depth when that's smaller.
+const maxFastBits = 10
+
+// A fastDecodeEntry is one slot of a huffmanTree's fastTable, describing
+// what the next fastBits bits of the stream decode to.
+//
+// If leaf is true, those bits (or a prefix of them, see bits) spell out a
+// complete code for sym. Otherwise the code is longer than fastBits bits
+// and node is the tree node reached after walking all fastBits of them, for
+// decodeFrom to continue from bit-by-bit.
+type fastDecodeEntry struct {
+	sym  uint16
+	node uint16
+	bits uint8
+	leaf bool
+}
+
+// fastTableBits picks the width of t's fast-decode table: wide enough to
+// cover every code of this tree up to maxFastBits, but no wider than the
+// tree is actually deep, since bits beyond that would only ever select
+// entries that all resolve via the same short code anyway.
+func fastTableBits(t *huffmanTree) uint8 {
+	depth := treeDepth(t, 0)
+	if depth > maxFastBits {
+		depth = maxFastBits
+	}
+	if depth < 1 {
+		depth = 1
+	}
+	return uint8(depth)
+}
+
+// treeDepth returns the number of edges from node down to its deepest leaf.
+func treeDepth(t *huffmanTree, node uint16) int {
+	n := &t.nodes[node]
+	depth := 1
+	if n.left != invalidNodeValue {
+		if d := 1 + treeDepth(t, n.left); d > depth {
+			depth = d
+		}
+	}
+	if n.right != invalidNodeValue {
+		if d := 1 + treeDepth(t, n.right); d > depth {
+			depth = d
+		}
+	}
+	return depth
+}
+
+// newFastTable builds a table of 2^bits entries for t, one per possible
+// value of the next bits bits of the stream, each produced by simulating
+// Decode's tree walk for that bit prefix.
+func newFastTable(t *huffmanTree, bits uint8) []fastDecodeEntry {
+	table := make([]fastDecodeEntry, 1<<bits)
+	for prefix := range table {
+		table[prefix] = fastTableEntry(t, uint16(prefix), bits)
+	}
+	return table
+}
+
+// fastTableEntry walks the tree along the path described by the top bits
+// bits of prefix, in the same order Decode consumes them, and reports
+// either the leaf it lands on or the node it's left at if bits runs out
+// first.
+func fastTableEntry(t *huffmanTree, prefix uint16, bits uint8) fastDecodeEntry {
+	nodeIndex := uint16(0)
+	for i := uint8(0); i < bits; i++ {
+		node := &t.nodes[nodeIndex]
+		bit := (prefix >> (bits - 1 - i)) & 1
+
+		var next, value uint16
+		if bit == 1 {
+			next, value = node.left, node.leftValue
+		} else {
+			next, value = node.right, node.rightValue
+		}
+
+		if next == invalidNodeValue {
+			return fastDecodeEntry{sym: value, bits: i + 1, leaf: true}
+		}
+		nodeIndex = next
+	}
+	return fastDecodeEntry{node: nodeIndex, bits: bits}
+}
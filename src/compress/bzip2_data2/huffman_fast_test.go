@@ -0,0 +1,127 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bzip2
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// makeTestStream builds a huffmanTree over n symbols with a skewed
+// frequency distribution, plus a long stream of symbols encoded against
+// it, both chosen to exercise a realistic mix of short and long codes.
+func makeTestStream(n, numSymbols int) (tree huffmanTree, symbols []uint16, encoded []byte, err error) {
+	r := rand.New(rand.NewSource(int64(n)))
+	freq := make([]uint32, n)
+	for i := range freq {
+		// A Zipf-like skew gives a realistic spread of code lengths,
+		// including some long ones for the fast table to fall back on.
+		freq[i] = uint32(1 + r.Intn(1+1000/(i+1)))
+	}
+	lengths := buildCodeLengths(freq, 20)
+
+	tree, err = newHuffmanTree(lengths)
+	if err != nil {
+		return huffmanTree{}, nil, nil, err
+	}
+
+	code, length := canonicalHuffmanCodeTable(lengths)
+
+	symbols = make([]uint16, numSymbols)
+	for i := range symbols {
+		symbols[i] = uint16(r.Intn(n))
+	}
+
+	var buf bytes.Buffer
+	bw := newBitWriter(&buf)
+	for _, s := range symbols {
+		bw.WriteBits(code[s], uint(length[s]))
+	}
+	// Pad with zero bits so a reader is never left short a partial byte;
+	// the tests and benchmarks below only ever read back len(symbols)
+	// symbols.
+	bw.WriteBits(0, 32)
+	if err := bw.Flush(); err != nil {
+		return huffmanTree{}, nil, nil, err
+	}
+
+	return tree, symbols, buf.Bytes(), nil
+}
+
+func TestFastTableMatchesSlowPath(t *testing.T) {
+	for _, n := range []int{2, 3, 10, 258} {
+		tree, symbols, encoded, err := makeTestStream(n, 5000)
+		if err != nil {
+			t.Fatalf("n=%d: %v", n, err)
+		}
+
+		if tree.fastBits == 0 || len(tree.fastTable) != 1<<tree.fastBits {
+			t.Fatalf("n=%d: fastTable not built as expected (fastBits=%d, len=%d)", n, tree.fastBits, len(tree.fastTable))
+		}
+
+		br := newBitReader(bytes.NewReader(encoded))
+		for i, want := range symbols {
+			if got := tree.Decode(&br); got != want {
+				t.Fatalf("n=%d symbol %d: Decode = %d, want %d", n, i, got, want)
+			}
+		}
+		if br.Err() != nil {
+			t.Fatalf("n=%d: %v", n, br.Err())
+		}
+	}
+}
+
+// TestFastTableAgainstDecodeFrom checks the fast table's output against the
+// pre-existing bit-by-bit walk directly, on the same stream read by two
+// independent bitReaders, rather than just checking both against the
+// original symbols.
+func TestFastTableAgainstDecodeFrom(t *testing.T) {
+	tree, symbols, encoded, err := makeTestStream(258, 5000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	brFast := newBitReader(bytes.NewReader(encoded))
+	brSlow := newBitReader(bytes.NewReader(encoded))
+	for i := range symbols {
+		got, want := tree.Decode(&brFast), tree.decodeFrom(&brSlow, 0)
+		if got != want {
+			t.Fatalf("symbol %d: fast path = %d, slow path = %d", i, got, want)
+		}
+	}
+}
+
+func BenchmarkDecodeFast(b *testing.B) {
+	tree, symbols, encoded, err := makeTestStream(258, 50000)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(encoded)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		br := newBitReader(bytes.NewReader(encoded))
+		for range symbols {
+			tree.Decode(&br)
+		}
+	}
+}
+
+func BenchmarkDecodeSlow(b *testing.B) {
+	tree, symbols, encoded, err := makeTestStream(258, 50000)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.SetBytes(int64(len(encoded)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		br := newBitReader(bytes.NewReader(encoded))
+		for range symbols {
+			tree.decodeFrom(&br, 0)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bzip2
+
+// Encode is the inverse of Decode: it returns the current move-to-front
+// index of b and moves b to the front of the list. The Writer uses this
+// both for the main MTF transform over the BWT output and, with a list of
+// table indexes, to MTF-encode the Huffman table selectors.
+func (m moveToFrontDecoder) Encode(b byte) int {
+	for i, c := range m {
+		if c == b {
+			copy(m[1:i+1], m[:i])
+			m[0] = b
+			return i
+		}
+	}
+	panic("bzip2: byte not present in move-to-front list")
+}
@@ -0,0 +1,346 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bzip2
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// These are the block-size levels accepted by NewWriterLevel. Level n uses
+// a block size of n * 100,000 bytes, exactly like the -1 through -9 flags
+// of the reference bzip2 command line tool: bigger blocks compress better
+// at the cost of more memory, both here and in whatever later reads the
+// stream back.
+const (
+	BestSpeed          = 1
+	BestCompression    = 9
+	DefaultCompression = 9
+)
+
+var errWriterClosed = errors.New("bzip2: Write called after Close")
+
+// A Writer is an io.WriteCloser. Writes to a Writer are compressed and
+// written to w.
+//
+// It is the caller's responsibility to call Close when done writing data,
+// to flush the final, possibly partial, block and the stream trailer. It
+// is not sufficient to close the underlying io.Writer.
+type Writer struct {
+	w         io.Writer
+	bw        bitWriter
+	level     int
+	blockSize int
+
+	block []byte // pending bytes, already through the RLE1 stage
+
+	// RLE1 state, carried across Write calls but reset at every block
+	// boundary: each block's run-length stream is decoded independently,
+	// so a run can never span two blocks.
+	lastByte     int
+	literalCount int
+	pendingExtra int
+
+	// blockCRC accumulates over the raw bytes belonging to the block
+	// currently being assembled; it is what actually gets checksummed,
+	// not the RLE1-encoded form of it that ends up BWT-transformed.
+	blockCRC uint32
+
+	fileCRC     uint32
+	wroteHeader bool
+	closed      bool
+	err         error
+}
+
+// NewWriter creates a new Writer that writes bzip2-compressed data to w at
+// DefaultCompression.
+func NewWriter(w io.Writer) *Writer {
+	z, _ := NewWriterLevel(w, DefaultCompression)
+	return z
+}
+
+// NewWriterLevel is like NewWriter but specifies the block size to use,
+// from BestSpeed to BestCompression.
+func NewWriterLevel(w io.Writer, level int) (*Writer, error) {
+	if level < BestSpeed || level > BestCompression {
+		return nil, fmt.Errorf("bzip2: invalid compression level %d", level)
+	}
+	return &Writer{
+		w:         w,
+		bw:        newBitWriter(w),
+		level:     level,
+		blockSize: level * 100 * 1000,
+		block:     make([]byte, 0, level*100*1000),
+		lastByte:  -1,
+	}, nil
+}
+
+// Write implements io.Writer. It buffers p, applying the RLE1 pass as it
+// goes, and transparently flushes complete blocks.
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.err != nil {
+		return 0, z.err
+	}
+	if z.closed {
+		return 0, errWriterClosed
+	}
+	if !z.wroteHeader {
+		if err := z.writeHeader(); err != nil {
+			z.err = err
+			return 0, err
+		}
+	}
+
+	for _, b := range p {
+		if err := z.rleWriteByte(b); err != nil {
+			z.err = err
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Close flushes any buffered data and writes the bzip2 stream trailer. It
+// does not close the underlying io.Writer.
+func (z *Writer) Close() error {
+	if z.err != nil {
+		return z.err
+	}
+	if z.closed {
+		return nil
+	}
+	z.closed = true
+
+	if !z.wroteHeader {
+		if err := z.writeHeader(); err != nil {
+			z.err = err
+			return err
+		}
+	}
+	if err := z.drainRLE(); err != nil {
+		z.err = err
+		return err
+	}
+	if err := z.flushBlock(); err != nil {
+		z.err = err
+		return err
+	}
+
+	z.bw.WriteBits64(bzip2FinalMagic, 48)
+	z.bw.WriteBits(z.fileCRC, 32)
+	if err := z.bw.Flush(); err != nil {
+		z.err = err
+		return err
+	}
+	return nil
+}
+
+func (z *Writer) writeHeader() error {
+	z.bw.WriteBits(bzip2FileMagic, 16)
+	z.bw.WriteBits('h', 8)
+	z.bw.WriteBits(uint32('0'+z.level), 8)
+	z.wroteHeader = true
+	return z.bw.Err()
+}
+
+// rleWriteByte runs the RLE1 state machine over a single raw byte,
+// appending its output (zero, one or two bytes) to the pending block. It is
+// the inverse of the byteRepeats bookkeeping in reader.readFromBlock: a run
+// of four equal bytes is followed by a byte counting any further repeats
+// (0-255) before decoding resumes.
+func (z *Writer) rleWriteByte(b byte) error {
+	if int(b) == z.lastByte {
+		z.blockCRC = updateCRC(z.blockCRC, []byte{b})
+		if z.literalCount < 4 {
+			z.literalCount++
+			return z.appendBlock(b)
+		}
+		z.pendingExtra++
+		if z.pendingExtra == 255 {
+			if err := z.appendBlock(byte(z.pendingExtra)); err != nil {
+				return err
+			}
+			z.literalCount = 0
+			z.pendingExtra = 0
+		}
+		return nil
+	}
+
+	if z.literalCount == 4 {
+		if err := z.appendBlock(byte(z.pendingExtra)); err != nil {
+			return err
+		}
+	}
+	// b is checksummed only now: the repeat count above may have filled
+	// and flushed the block, in which case b starts the next one.
+	z.blockCRC = updateCRC(z.blockCRC, []byte{b})
+	z.lastByte = int(b)
+	z.literalCount = 1
+	z.pendingExtra = 0
+	return z.appendBlock(b)
+}
+
+// drainRLE flushes a repeat count left pending by a run that was still
+// in progress when the input ended.
+func (z *Writer) drainRLE() error {
+	if z.literalCount == 4 {
+		if err := z.appendBlock(byte(z.pendingExtra)); err != nil {
+			return err
+		}
+		z.literalCount = 0
+		z.pendingExtra = 0
+	}
+	return nil
+}
+
+func (z *Writer) appendBlock(b byte) error {
+	z.block = append(z.block, b)
+	if len(z.block) < z.blockSize {
+		return nil
+	}
+	return z.flushBlock()
+}
+
+// flushBlock encodes and writes the pending block, if any, and resets the
+// RLE1 state: every block is decoded independently, so nothing about a run
+// in progress carries over to the next one.
+func (z *Writer) flushBlock() error {
+	if len(z.block) == 0 {
+		return nil
+	}
+	if err := z.encodeBlock(z.block, z.blockCRC); err != nil {
+		return err
+	}
+	z.block = z.block[:0]
+	z.lastByte = -1
+	z.literalCount = 0
+	z.pendingExtra = 0
+	z.blockCRC = 0
+	return nil
+}
+
+// encodeBlock runs the full compression pipeline over data and writes the
+// resulting block: BWT, then move-to-front plus RLE2, then a multi-table
+// canonical Huffman coding of the result, framed with the block's magic
+// number, CRC and BWT origin pointer.
+func (z *Writer) encodeBlock(data []byte, crc uint32) error {
+	bw := &z.bw
+
+	z.fileCRC = (z.fileCRC<<1 | z.fileCRC>>31) ^ crc
+
+	transformed, origPtr := forwardBWT(data)
+
+	used := symbolsPresent(transformed)
+	symbols := mtfRLE2Encode(transformed, used)
+	alphaSize := len(used) + 2
+
+	groups := splitGroups(symbols)
+	tables, selectors := buildTables(groups, alphaSize)
+
+	bw.WriteBits64(bzip2BlockMagic, 48)
+	bw.WriteBits(crc, 32)
+	bw.WriteBit(false) // randomized: deprecated, always unset
+	bw.WriteBits(origPtr, 24)
+
+	writeUsedBitmap(bw, used)
+
+	bw.WriteBits(uint32(len(tables)), 3)
+	bw.WriteBits(uint32(len(selectors)), 15)
+	writeSelectors(bw, selectors, len(tables))
+	for _, lengths := range tables {
+		writeCodeLengths(bw, lengths)
+	}
+	writeSymbols(bw, groups, tables, selectors)
+
+	return bw.Err()
+}
+
+// writeUsedBitmap writes the two-level 16x16 bitmap of byte values present
+// in the block, which the decoder uses to reconstruct the initial
+// move-to-front list.
+func writeUsedBitmap(bw *bitWriter, used []byte) {
+	var present [256]bool
+	for _, b := range used {
+		present[b] = true
+	}
+
+	var rangeUsed uint16
+	for r := 0; r < 16; r++ {
+		for s := 0; s < 16; s++ {
+			if present[16*r+s] {
+				rangeUsed |= 1 << (15 - r)
+				break
+			}
+		}
+	}
+	bw.WriteBits(uint32(rangeUsed), 16)
+
+	for r := 0; r < 16; r++ {
+		if rangeUsed&(1<<(15-r)) == 0 {
+			continue
+		}
+		var bits uint16
+		for s := 0; s < 16; s++ {
+			if present[16*r+s] {
+				bits |= 1 << (15 - s)
+			}
+		}
+		bw.WriteBits(uint32(bits), 16)
+	}
+}
+
+// writeSelectors writes the per-group table indexes, move-to-front encoded
+// and then unary coded, mirroring the mtfTreeDecoder loop in readBlock.
+func writeSelectors(bw *bitWriter, selectors []uint8, numTables int) {
+	mtf := newMTFDecoderWithRange(numTables)
+	for _, sel := range selectors {
+		c := mtf.Encode(sel)
+		for i := 0; i < c; i++ {
+			bw.WriteBit(true)
+		}
+		bw.WriteBit(false)
+	}
+}
+
+// writeCodeLengths writes one table's code lengths as a 5-bit starting
+// value followed by, for each symbol in turn, a run of increment/decrement
+// steps terminated by a zero bit, exactly as readBlock's delta decoder
+// expects.
+func writeCodeLengths(bw *bitWriter, lengths []uint8) {
+	length := int(lengths[0])
+	bw.WriteBits(uint32(length), 5)
+
+	for _, l := range lengths {
+		for length < int(l) {
+			bw.WriteBit(true)
+			bw.WriteBit(false) // increment
+			length++
+		}
+		for length > int(l) {
+			bw.WriteBit(true)
+			bw.WriteBit(true) // decrement
+			length--
+		}
+		bw.WriteBit(false)
+	}
+}
+
+// writeSymbols writes the MTF/RLE2 symbol stream, selecting each group's
+// Huffman table as recorded in selectors.
+func writeSymbols(bw *bitWriter, groups [][]uint16, tables [][]uint8, selectors []uint8) {
+	codeOf := make([][]uint32, len(tables))
+	lenOf := make([][]uint8, len(tables))
+	for t, lengths := range tables {
+		codeOf[t], lenOf[t] = canonicalHuffmanCodeTable(lengths)
+	}
+
+	for gi, g := range groups {
+		t := selectors[gi]
+		for _, s := range g {
+			bw.WriteBits(codeOf[t][s], uint(lenOf[t][s]))
+		}
+	}
+}
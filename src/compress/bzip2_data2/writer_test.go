@@ -0,0 +1,84 @@
+// Copyright 2011 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package bzip2
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+	"testing/quick"
+)
+
+func roundTrip(t *testing.T, level int, input []byte) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w, err := NewWriterLevel(&buf, level)
+	if err != nil {
+		t.Fatalf("NewWriterLevel(%d): %v", level, err)
+	}
+	if _, err := w.Write(input); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	got, err := io.ReadAll(NewReader(&buf))
+	if err != nil {
+		t.Fatalf("decoding round trip: %v", err)
+	}
+	return got
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	tests := []struct {
+		desc  string
+		input []byte
+	}{
+		{"empty", nil},
+		{"single byte", []byte("x")},
+		{"hello world", []byte("hello world\n")},
+		{"long run", bytes.Repeat([]byte{'a'}, 10000)},
+		{"run exactly at rle threshold", bytes.Repeat([]byte{'z'}, 4)},
+		{"all byte values", func() []byte {
+			b := make([]byte, 256*4)
+			for i := range b {
+				b[i] = byte(i / 4)
+			}
+			return b
+		}()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			got := roundTrip(t, BestCompression, test.input)
+			if !bytes.Equal(got, test.input) {
+				t.Fatalf("round trip mismatch: got %d bytes, want %d bytes", len(got), len(test.input))
+			}
+		})
+	}
+}
+
+func TestWriterRoundTripAcrossBlockBoundary(t *testing.T) {
+	const level = BestSpeed // 100,000 byte blocks
+	input := make([]byte, 100*1000*2+137)
+	rand.New(rand.NewSource(1)).Read(input)
+
+	got := roundTrip(t, level, input)
+	if !bytes.Equal(got, input) {
+		t.Fatalf("round trip mismatch across multiple blocks")
+	}
+}
+
+func TestWriterRoundTripFuzz(t *testing.T) {
+	f := func(input []byte) bool {
+		return bytes.Equal(roundTrip(t, BestSpeed, input), input)
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 200}); err != nil {
+		t.Error(err)
+	}
+}